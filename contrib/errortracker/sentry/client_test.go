@@ -0,0 +1,166 @@
+package sentry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+// fakeHeader is a minimal transport.Header backed by a map, for tests that
+// don't need a real grpc.Transport or http.Transport.
+type fakeHeader map[string][]string
+
+func (h fakeHeader) Get(key string) string {
+	if vs := h[key]; len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+func (h fakeHeader) Set(key, value string) { h[key] = []string{value} }
+func (h fakeHeader) Add(key, value string) { h[key] = append(h[key], value) }
+func (h fakeHeader) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+func (h fakeHeader) Values(key string) []string { return h[key] }
+
+// fakeTransport is a minimal transport.Transporter for tests that don't need
+// a real grpc.Transport or http.Transport.
+type fakeTransport struct {
+	kind      transport.Kind
+	endpoint  string
+	operation string
+	header    transport.Header
+}
+
+func (t *fakeTransport) Kind() transport.Kind            { return t.kind }
+func (t *fakeTransport) Endpoint() string                { return t.endpoint }
+func (t *fakeTransport) Operation() string               { return t.operation }
+func (t *fakeTransport) RequestHeader() transport.Header { return t.header }
+func (t *fakeTransport) ReplyHeader() transport.Header   { return t.header }
+
+func newTestHub(t *testing.T) *sentry.Hub {
+	t.Helper()
+	client, err := sentry.NewClient(sentry.ClientOptions{})
+	if err != nil {
+		t.Fatalf("sentry.NewClient: %v", err)
+	}
+	return sentry.NewHub(client, sentry.NewScope())
+}
+
+func lastBreadcrumb(t *testing.T, hub *sentry.Hub) *sentry.Breadcrumb {
+	t.Helper()
+	event := hub.Scope().ApplyToEvent(sentry.NewEvent(), nil)
+	if event == nil || len(event.Breadcrumbs) == 0 {
+		t.Fatalf("expected at least one breadcrumb to be recorded")
+	}
+	return event.Breadcrumbs[len(event.Breadcrumbs)-1]
+}
+
+func TestClientRecordsMethodAndOperationOnBreadcrumb(t *testing.T) {
+	hub := newTestHub(t)
+	ctx := sentry.SetHubOnContext(context.Background(), hub)
+	ctx = transport.NewClientContext(ctx, &fakeTransport{
+		kind:      transport.KindGRPC,
+		endpoint:  "discovery:///greeter",
+		operation: "/helloworld.Greeter/SayHello",
+		header:    fakeHeader{},
+	})
+
+	handler := Client()(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "reply", nil
+	})
+	if _, err := handler(ctx, "req"); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+
+	crumb := lastBreadcrumb(t, hub)
+	if crumb.Type != "grpc" {
+		t.Errorf("Type = %q, want %q", crumb.Type, "grpc")
+	}
+	if crumb.Data["method"] != "/helloworld.Greeter/SayHello" {
+		t.Errorf("Data[method] = %v, want the gRPC operation", crumb.Data["method"])
+	}
+	if crumb.Data["endpoint"] != "discovery:///greeter" {
+		t.Errorf("Data[endpoint] = %v, want the endpoint", crumb.Data["endpoint"])
+	}
+}
+
+func TestClientBreadcrumbTypeReflectsTransportKind(t *testing.T) {
+	hub := newTestHub(t)
+	ctx := sentry.SetHubOnContext(context.Background(), hub)
+	ctx = transport.NewClientContext(ctx, &fakeTransport{
+		kind:      transport.KindHTTP,
+		operation: "/greeter",
+		header:    fakeHeader{},
+	})
+
+	handler := Client()(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	if _, err := handler(ctx, "req"); err == nil {
+		t.Fatalf("expected handler error to propagate")
+	}
+
+	crumb := lastBreadcrumb(t, hub)
+	if crumb.Type != "http" {
+		t.Errorf("Type = %q, want %q", crumb.Type, "http")
+	}
+	if crumb.Level != sentry.LevelError {
+		t.Errorf("Level = %q, want error", crumb.Level)
+	}
+	if crumb.Data["error"] != "boom" {
+		t.Errorf("Data[error] = %v, want %q", crumb.Data["error"], "boom")
+	}
+}
+
+// TestServerBindsHubSoClientCanPropagateTrace is a regression test for a bug
+// where Server started spans without binding its per-request hub onto ctx
+// via sentry.SetHubOnContext. sentry.StartSpan resolves its hub straight
+// from ctx, so without that bind the span landed on the global hub instead
+// of the one Client and downstream code observe, and propagateTrace's
+// hub.Scope().Span() lookup was always nil.
+func TestServerBindsHubSoClientCanPropagateTrace(t *testing.T) {
+	hub := newTestHub(t)
+	ctx := sentry.SetHubOnContext(context.Background(), hub)
+	ctx = transport.NewServerContext(ctx, &fakeTransport{
+		kind:      "test",
+		operation: "/helloworld.Greeter/SayHello",
+		header:    fakeHeader{},
+	})
+
+	var propagated transport.Header
+	inner := func(ctx context.Context, req interface{}) (interface{}, error) {
+		clientCtx := transport.NewClientContext(ctx, &fakeTransport{
+			kind:      transport.KindHTTP,
+			operation: "/downstream",
+			header:    fakeHeader{},
+		})
+		clientHandler := Client()(func(ctx context.Context, req interface{}) (interface{}, error) {
+			tr, _ := transport.FromClientContext(ctx)
+			propagated = tr.RequestHeader()
+			return nil, nil
+		})
+		return clientHandler(clientCtx, req)
+	}
+
+	serverHandler := Server()(inner)
+	if _, err := serverHandler(ctx, "req"); err != nil {
+		t.Fatalf("serverHandler: %v", err)
+	}
+
+	if propagated == nil {
+		t.Fatalf("expected the nested client middleware to run")
+	}
+	if got := propagated.Get(sentryTraceHeader); got == "" {
+		t.Errorf("sentry-trace header was not propagated to the downstream call")
+	}
+}
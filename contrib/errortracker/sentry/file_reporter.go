@@ -0,0 +1,207 @@
+package sentry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// crashFilePattern matches the crash report files a FileReporter itself
+// writes, so rotation never touches unrelated files that happen to live
+// under the same dir.
+const crashFilePattern = "crash-*.jsonl"
+
+// FileReporter is a CrashReporter that persists panics as newline-delimited
+// JSON on local disk. It is meant as a fallback for air-gapped deployments,
+// or for buffering panics whenever the Sentry DSN is unreachable, and can be
+// combined with the default hub-backed reporter via WithReporter.
+type FileReporter struct {
+	dir         string
+	maxFileSize int64
+	maxFiles    int
+
+	mu      sync.Mutex
+	file    *os.File
+	written int64
+}
+
+// FileReporterOption configures a FileReporter.
+type FileReporterOption func(*FileReporter)
+
+// WithMaxFileSize rotates to a new file once the current one reaches size
+// bytes. The default is 10MiB.
+func WithMaxFileSize(size int64) FileReporterOption {
+	return func(r *FileReporter) {
+		r.maxFileSize = size
+	}
+}
+
+// WithMaxFiles caps the number of rotated crash report files kept under dir;
+// the oldest files are removed once the limit is exceeded. The default is
+// 100.
+func WithMaxFiles(n int) FileReporterOption {
+	return func(r *FileReporter) {
+		r.maxFiles = n
+	}
+}
+
+// NewFileReporter creates a FileReporter that writes crash reports under
+// dir, creating it if necessary.
+func NewFileReporter(dir string, opts ...FileReporterOption) (*FileReporter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("sentry: create crash report dir: %w", err)
+	}
+	r := &FileReporter{
+		dir:         dir,
+		maxFileSize: 10 * 1024 * 1024,
+		maxFiles:    100,
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r, nil
+}
+
+// crashEnvelope is the JSON shape written for each recovered panic.
+type crashEnvelope struct {
+	Time       time.Time              `json:"time"`
+	Message    string                 `json:"message"`
+	Stacktrace []crashFrame           `json:"stacktrace,omitempty"`
+	Request    interface{}            `json:"request,omitempty"`
+	Headers    map[string]interface{} `json:"headers,omitempty"`
+	Tags       map[string]string      `json:"tags,omitempty"`
+}
+
+type crashFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// Report appends event to the current crash report file as a single JSON
+// line, rotating to a new file once the size cap is reached.
+func (r *FileReporter) Report(_ context.Context, event *sentry.Event) error {
+	line, err := json.Marshal(envelopeFromEvent(event))
+	if err != nil {
+		return fmt.Errorf("sentry: marshal crash report: %w", err)
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		if err := r.openFile(); err != nil {
+			return err
+		}
+	}
+	n, err := r.file.Write(line)
+	if err != nil {
+		return fmt.Errorf("sentry: write crash report: %w", err)
+	}
+	r.written += int64(n)
+	if r.written >= r.maxFileSize {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the currently open crash report file, if any.
+func (r *FileReporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *FileReporter) openFile() error {
+	name := filepath.Join(r.dir, fmt.Sprintf("crash-%d.jsonl", time.Now().UnixNano()))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("sentry: open crash report file: %w", err)
+	}
+	r.file = f
+	r.written = 0
+	return nil
+}
+
+// rotate closes the current file and, if the number of crash report files
+// under dir now exceeds maxFiles, removes the oldest ones. Only files
+// matching crashFilePattern are considered, so anything else living in dir
+// is left untouched; matching files left there by an earlier FileReporter
+// are counted and may be removed too.
+func (r *FileReporter) rotate() error {
+	if r.file != nil {
+		_ = r.file.Close()
+		r.file = nil
+	}
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return fmt.Errorf("sentry: list crash report dir: %w", err)
+	}
+	var ours []os.DirEntry
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if matched, _ := filepath.Match(crashFilePattern, e.Name()); matched {
+			ours = append(ours, e)
+		}
+	}
+	if len(ours) <= r.maxFiles {
+		return nil
+	}
+	sort.Slice(ours, func(i, j int) bool { return ours[i].Name() < ours[j].Name() })
+	for _, e := range ours[:len(ours)-r.maxFiles] {
+		_ = os.Remove(filepath.Join(r.dir, e.Name()))
+	}
+	return nil
+}
+
+func envelopeFromEvent(event *sentry.Event) crashEnvelope {
+	envelope := crashEnvelope{
+		Time:    event.Timestamp,
+		Message: event.Message,
+		Tags:    event.Tags,
+	}
+	if len(event.Exception) > 0 {
+		exc := event.Exception[len(event.Exception)-1]
+		if envelope.Message == "" {
+			envelope.Message = exc.Value
+		}
+		if exc.Stacktrace != nil {
+			for _, frame := range exc.Stacktrace.Frames {
+				envelope.Stacktrace = append(envelope.Stacktrace, crashFrame{
+					Function: frame.Function,
+					File:     frame.Filename,
+					Line:     frame.Lineno,
+				})
+			}
+		}
+	}
+	if body, ok := event.Extra["request_body"]; ok {
+		// A WithBodyScrubber ran; prefer its (already redacted) output over
+		// the raw request captured by the middleware.
+		envelope.Request = body
+	} else if event.Request != nil && (event.Request.URL != "" || event.Request.Method != "") {
+		envelope.Request = event.Request
+	}
+	if headers, ok := event.Contexts["Headers"].(map[string]interface{}); ok {
+		envelope.Headers = headers
+	}
+	return envelope
+}
@@ -0,0 +1,55 @@
+package sentry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+func TestFileReporterRotationOnlyRemovesItsOwnFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	other := filepath.Join(dir, "keep-me.txt")
+	if err := os.WriteFile(other, []byte("do not touch"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	r, err := NewFileReporter(dir, WithMaxFileSize(1), WithMaxFiles(1))
+	if err != nil {
+		t.Fatalf("NewFileReporter: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		event := sentry.NewEvent()
+		event.Timestamp = time.Now()
+		event.Message = "boom"
+		if err := r.Report(context.Background(), event); err != nil {
+			t.Fatalf("Report: %v", err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, err := os.Stat(other); err != nil {
+		t.Fatalf("rotation removed a file it did not write: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	var crashFiles int
+	for _, e := range entries {
+		if matched, _ := filepath.Match(crashFilePattern, e.Name()); matched {
+			crashFiles++
+		}
+	}
+	if crashFiles > 1 {
+		t.Fatalf("got %d crash report files, want at most maxFiles=1", crashFiles)
+	}
+}
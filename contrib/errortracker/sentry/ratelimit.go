@@ -0,0 +1,135 @@
+package sentry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithSampleRate probabilistically drops a fraction of recovered panics
+// before they are ever turned into a Sentry event, so a runaway panic loop
+// cannot exhaust the project's quota. rate is in [0.0, 1.0]; the default,
+// 1.0, delivers every panic.
+func WithSampleRate(rate float64) Option {
+	return func(opts *options) {
+		opts.sampleRate = rate
+	}
+}
+
+// WithRateLimit limits panic delivery to a sustained rate of events panics
+// per duration, with bursts of at most events panics, per (transport kind,
+// operation, panic fingerprint), implemented as a token bucket. Panics dropped while throttled are still counted; the count
+// is attached as a "suppressed_since_last" extra on the next panic that is
+// actually delivered for that key. Buckets that go idle for a while are
+// evicted automatically, so a storm of distinct panic messages cannot grow
+// memory without bound.
+func WithRateLimit(events int, per time.Duration) Option {
+	return func(opts *options) {
+		opts.rateLimit = &rateLimitConfig{events: events, per: per}
+	}
+}
+
+type rateLimitConfig struct {
+	events int
+	per    time.Duration
+}
+
+// panicLimiter is a token bucket per (transport kind, operation, panic
+// fingerprint) key, used to throttle delivery of repeated panics. Buckets
+// that have gone idle for longer than idleTTL are swept out on allow, so a
+// storm of distinct panics (each minting its own key) cannot grow buckets
+// without bound.
+type panicLimiter struct {
+	events  int
+	per     time.Duration
+	idleTTL time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*panicBucket
+	lastSweep time.Time
+}
+
+type panicBucket struct {
+	tokens     float64
+	lastRefill time.Time
+	suppressed int
+}
+
+func newPanicLimiter(events int, per time.Duration) *panicLimiter {
+	idleTTL := 2 * per
+	if idleTTL < time.Minute {
+		idleTTL = time.Minute
+	}
+	return &panicLimiter{
+		events:  events,
+		per:     per,
+		idleTTL: idleTTL,
+		buckets: make(map[string]*panicBucket),
+	}
+}
+
+// allow reports whether a panic matching key may be delivered now. When it
+// may not, the drop is recorded so the next delivered panic for the same
+// key can report how many were suppressed in between.
+//
+// Each key gets its own bucket of l.events tokens that refills continuously
+// at a rate of l.events per l.per, capped at l.events tokens; a bucket
+// starts full so the first panic for a new key is always allowed. This is
+// a genuine token bucket, not a fixed window: a burst is capped at l.events
+// panics and the bucket does not reset at a window boundary, so in any span
+// of length d at most l.events + l.events*d/l.per panics are allowed.
+func (l *panicLimiter) allow(key string) (ok bool, suppressedSinceLast int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweepLocked(now)
+
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &panicBucket{tokens: float64(l.events), lastRefill: now}
+		l.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.lastRefill)
+		b.tokens += elapsed.Seconds() / l.per.Seconds() * float64(l.events)
+		if b.tokens > float64(l.events) {
+			b.tokens = float64(l.events)
+		}
+		b.lastRefill = now
+	}
+
+	if b.tokens < 1 {
+		b.suppressed++
+		return false, 0
+	}
+	b.tokens--
+	suppressedSinceLast, b.suppressed = b.suppressed, 0
+	return true, suppressedSinceLast
+}
+
+// sweepLocked removes buckets idle for longer than l.idleTTL. l.mu must
+// already be held. It runs at most once per l.idleTTL/4, so the cost stays
+// off the common path; an evicted key simply starts over with a full
+// bucket next time it is seen, which is indistinguishable from a key seen
+// for the first time.
+func (l *panicLimiter) sweepLocked(now time.Time) {
+	if !l.lastSweep.IsZero() && now.Sub(l.lastSweep) < l.idleTTL/4 {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastRefill) > l.idleTTL {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// panicFingerprint derives a short, stable fingerprint from a recovered
+// panic value, used to bucket repeated occurrences of the same panic
+// separately from unrelated ones.
+func panicFingerprint(recovered interface{}) string {
+	sum := sha256.Sum256([]byte(fmt.Sprint(recovered)))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,120 @@
+package sentry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPanicLimiterAllowsUpToEventsThenThrottles(t *testing.T) {
+	l := newPanicLimiter(2, time.Hour)
+	key := "grpc|/svc/Method|abc"
+
+	if ok, _ := l.allow(key); !ok {
+		t.Fatalf("expected first panic to be allowed")
+	}
+	if ok, _ := l.allow(key); !ok {
+		t.Fatalf("expected second panic to be allowed")
+	}
+	if ok, _ := l.allow(key); ok {
+		t.Fatalf("expected third panic within the window to be throttled")
+	}
+}
+
+func TestPanicLimiterReportsSuppressedSinceLast(t *testing.T) {
+	l := newPanicLimiter(1, time.Hour)
+	key := "grpc|/svc/Method|abc"
+
+	if ok, _ := l.allow(key); !ok {
+		t.Fatalf("expected first panic to be allowed")
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.allow(key); ok {
+			t.Fatalf("expected panic %d to be throttled", i)
+		}
+	}
+
+	// Simulate the bucket having refilled by rewinding lastRefill, instead
+	// of the test taking an hour to run.
+	l.mu.Lock()
+	l.buckets[key].lastRefill = time.Now().Add(-time.Hour)
+	l.mu.Unlock()
+
+	ok, suppressed := l.allow(key)
+	if !ok {
+		t.Fatalf("expected panic to be allowed after the bucket refilled")
+	}
+	if suppressed != 3 {
+		t.Fatalf("suppressedSinceLast = %d, want 3", suppressed)
+	}
+}
+
+func TestPanicLimiterDoesNotDoubleAllowanceAcrossWindowBoundary(t *testing.T) {
+	// Regression test: a fixed-window counter resets fully at the window
+	// boundary and can allow 2x events in a short span straddling it. A
+	// real token bucket refills gradually instead, so allowing `events` at
+	// the very start of a window and then immediately half a window later
+	// must not also allow a full new batch of `events`.
+	l := newPanicLimiter(4, time.Hour)
+	key := "grpc|/svc/Method|abc"
+
+	for i := 0; i < 4; i++ {
+		if ok, _ := l.allow(key); !ok {
+			t.Fatalf("expected panic %d to be allowed", i)
+		}
+	}
+
+	// Half the window has passed: a real token bucket has refilled about
+	// half of its capacity (~2 tokens), not a fresh 4.
+	l.mu.Lock()
+	l.buckets[key].lastRefill = time.Now().Add(-30 * time.Minute)
+	l.mu.Unlock()
+
+	allowed := 0
+	for i := 0; i < 4; i++ {
+		if ok, _ := l.allow(key); ok {
+			allowed++
+		}
+	}
+	if allowed >= 4 {
+		t.Fatalf("allowed %d panics halfway through the window, want fewer than events=4", allowed)
+	}
+}
+
+func TestPanicLimiterEvictsIdleBuckets(t *testing.T) {
+	l := newPanicLimiter(1, time.Minute)
+
+	if ok, _ := l.allow("stale-key"); !ok {
+		t.Fatalf("expected first panic for stale-key to be allowed")
+	}
+
+	// Age the bucket well past idleTTL and force the next allow to sweep
+	// immediately, instead of waiting for idleTTL/4 to actually pass.
+	l.mu.Lock()
+	l.buckets["stale-key"].lastRefill = time.Now().Add(-time.Hour)
+	l.lastSweep = time.Time{}
+	l.mu.Unlock()
+
+	l.allow("fresh-key")
+
+	l.mu.Lock()
+	_, stillPresent := l.buckets["stale-key"]
+	bucketCount := len(l.buckets)
+	l.mu.Unlock()
+
+	if stillPresent {
+		t.Fatalf("expected the idle bucket for stale-key to be evicted")
+	}
+	if bucketCount != 1 {
+		t.Fatalf("got %d buckets after sweep, want 1 (only fresh-key)", bucketCount)
+	}
+}
+
+func TestPanicLimiterKeysAreIndependent(t *testing.T) {
+	l := newPanicLimiter(1, time.Hour)
+	if ok, _ := l.allow("a"); !ok {
+		t.Fatalf("expected key a to be allowed")
+	}
+	if ok, _ := l.allow("b"); !ok {
+		t.Fatalf("expected independent key b to be allowed")
+	}
+}
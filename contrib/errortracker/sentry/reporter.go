@@ -0,0 +1,61 @@
+package sentry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// CrashReporter persists a recovered panic, e.g. by shipping it to Sentry or
+// writing it to disk. Server invokes every configured reporter for each
+// recovered panic; a failing reporter does not prevent the others from
+// running.
+type CrashReporter interface {
+	Report(ctx context.Context, event *sentry.Event) error
+}
+
+// WithReporter appends one or more CrashReporter implementations that
+// recovered panics are sent to, in the order given. When no reporter is
+// configured, Server reports through the hub attached to the request
+// context, exactly as before; to keep that Sentry delivery while adding
+// e.g. a FileReporter, include a NewHubReporter explicitly:
+//
+//	sentry.WithReporter(sentry.NewHubReporter(hub, false, 0), fileReporter)
+func WithReporter(reporters ...CrashReporter) Option {
+	return func(opts *options) {
+		opts.reporters = append(opts.reporters, reporters...)
+	}
+}
+
+// HubReporter is the default CrashReporter, delivering events through a
+// *sentry.Hub the same way recoverWithSentry always has.
+type HubReporter struct {
+	hub             *sentry.Hub
+	waitForDelivery bool
+	timeout         time.Duration
+}
+
+// NewHubReporter returns a CrashReporter that delivers events through hub.
+// waitForDelivery and timeout mirror WithWaitForDelivery/WithTimeout for
+// this reporter specifically.
+func NewHubReporter(hub *sentry.Hub, waitForDelivery bool, timeout time.Duration) *HubReporter {
+	return &HubReporter{hub: hub, waitForDelivery: waitForDelivery, timeout: timeout}
+}
+
+// Report delivers event through the hub's client directly, bypassing the
+// hub's own scope: reportPanic already applied the hub's scope to event
+// once before calling any reporter, and re-applying it here would duplicate
+// scope-derived data such as breadcrumbs.
+func (r *HubReporter) Report(_ context.Context, event *sentry.Event) error {
+	client := r.hub.Client()
+	if client == nil {
+		return fmt.Errorf("sentry: hub has no client")
+	}
+	eventID := client.CaptureEvent(event, nil, nil)
+	if eventID != nil && r.waitForDelivery {
+		r.hub.Flush(r.timeout)
+	}
+	return nil
+}
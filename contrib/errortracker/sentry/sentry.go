@@ -2,7 +2,10 @@ package sentry
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
 	"net"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -16,15 +19,43 @@ import (
 	http2 "github.com/go-kratos/kratos/v2/transport/http"
 )
 
-const valuesKey = "sentry"
+const (
+	valuesKey = "sentry"
+
+	// sentryTraceHeader and sentryBaggageHeader are propagated on outgoing
+	// requests so the callee can join the caller's trace.
+	sentryTraceHeader   = "sentry-trace"
+	sentryBaggageHeader = "baggage"
+)
+
+// defaultHeaderDenylist is applied to every Server middleware regardless of
+// WithHeaderDenylist, so that common credential headers are never attached
+// to a Sentry event by accident.
+var defaultHeaderDenylist = []string{
+	"Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"Grpc-Metadata-Authorization",
+	"X-Api-Key",
+}
 
 type Option func(*options)
 
 type options struct {
-	repanic         bool
-	waitForDelivery bool
-	timeout         time.Duration
-	tags            map[string]interface{}
+	repanic          bool
+	waitForDelivery  bool
+	timeout          time.Duration
+	tags             map[string]interface{}
+	tracesSampleRate float64
+	tracesSampler    func(ctx sentry.SamplingContext) sentry.Sampled
+	reporters        []CrashReporter
+	headerAllowlist  map[string]struct{}
+	headerDenylist   map[string]struct{}
+	bodyScrubber     func(ctx context.Context, req interface{}) interface{}
+	beforeSend       func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event
+	sampleRate       float64
+	rateLimit        *rateLimitConfig
+	limiter          *panicLimiter
 }
 
 // Repanic configures whether Sentry should repanic after recovery, in most cases it should be set to true.
@@ -55,21 +86,111 @@ func WithTags(kvs map[string]interface{}) Option {
 	}
 }
 
-// Server returns a new server middleware for Sentry.
+// WithTracesSampleRate enables performance tracing and samples the given
+// fraction (0.0-1.0) of transactions started by Server. It has no effect
+// once WithTracesSampler is set.
+func WithTracesSampleRate(rate float64) Option {
+	return func(opts *options) {
+		opts.tracesSampleRate = rate
+	}
+}
+
+// WithTracesSampler enables performance tracing and lets the caller decide,
+// per transaction, whether it should be sampled. It takes precedence over
+// WithTracesSampleRate.
+func WithTracesSampler(sampler func(ctx sentry.SamplingContext) sentry.Sampled) Option {
+	return func(opts *options) {
+		opts.tracesSampler = sampler
+	}
+}
+
+// WithHeaderAllowlist restricts the request headers attached to Sentry
+// events to this list, matched case-insensitively. When set, it takes
+// precedence over WithHeaderDenylist and the default deny list.
+func WithHeaderAllowlist(headers []string) Option {
+	return func(opts *options) {
+		opts.headerAllowlist = newHeaderSet(headers)
+	}
+}
+
+// WithHeaderDenylist adds headers, on top of the default deny list
+// (Authorization, Cookie, Set-Cookie, Grpc-Metadata-Authorization,
+// X-Api-Key), that must never be attached to a Sentry event.
+func WithHeaderDenylist(headers []string) Option {
+	return func(opts *options) {
+		if opts.headerDenylist == nil {
+			opts.headerDenylist = make(map[string]struct{})
+		}
+		for k := range newHeaderSet(headers) {
+			opts.headerDenylist[k] = struct{}{}
+		}
+	}
+}
+
+// WithBodyScrubber registers a function that redacts sensitive fields from
+// the request before it is attached to a recovered panic's event.
+func WithBodyScrubber(scrubber func(ctx context.Context, req interface{}) interface{}) Option {
+	return func(opts *options) {
+		opts.bodyScrubber = scrubber
+	}
+}
+
+// WithBeforeSend registers a hook that runs on every event right before it
+// is handed to the configured CrashReporters, mirroring the BeforeSend hook
+// exposed by sentry.ClientOptions. Returning nil drops the event.
+func WithBeforeSend(hook func(event *sentry.Event, hint *sentry.EventHint) *sentry.Event) Option {
+	return func(opts *options) {
+		opts.beforeSend = hook
+	}
+}
+
+func newHeaderSet(headers []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(headers))
+	for _, h := range headers {
+		set[strings.ToLower(h)] = struct{}{}
+	}
+	return set
+}
+
+// headerAllowed reports whether key may be attached to a Sentry event under
+// the configured allow/deny lists.
+func (conf options) headerAllowed(key string) bool {
+	key = strings.ToLower(key)
+	if len(conf.headerAllowlist) > 0 {
+		_, ok := conf.headerAllowlist[key]
+		return ok
+	}
+	_, denied := conf.headerDenylist[key]
+	return !denied
+}
+
+// Server returns a new server middleware for Sentry. Besides recovering
+// panics, it starts a performance tracing span for every request and stores
+// it on the context so downstream handlers and the client middleware can
+// create child spans from it.
 func Server(opts ...Option) middleware.Middleware {
-	conf := options{repanic: true}
+	conf := options{repanic: true, headerDenylist: newHeaderSet(defaultHeaderDenylist), sampleRate: 1}
 	for _, o := range opts {
 		o(&conf)
 	}
 	if conf.timeout == 0 {
 		conf.timeout = 2 * time.Second
 	}
+	if conf.rateLimit != nil {
+		conf.limiter = newPanicLimiter(conf.rateLimit.events, conf.rateLimit.per)
+	}
 	return func(handler middleware.Handler) middleware.Handler {
 		return func(ctx context.Context, req interface{}) (reply interface{}, err error) {
 			hub := sentry.GetHubFromContext(ctx)
 			if hub == nil {
 				hub = sentry.CurrentHub().Clone()
 			}
+			// Bind hub onto ctx via the SDK's own context key, not just
+			// valuesKey below: sentry.StartSpan resolves its hub that way,
+			// and without it every span (and anything derived from it, like
+			// trace propagation in Client) would attach to the global hub
+			// instead of this request's.
+			ctx = sentry.SetHubOnContext(ctx, hub)
 			scope := hub.Scope()
 
 			for k, v := range conf.tags {
@@ -83,9 +204,12 @@ func Server(opts ...Option) middleware.Middleware {
 				}
 			}
 
+			var span *sentry.Span
 			if tr, ok := transport.FromServerContext(ctx); ok {
+				op := "http.server"
 				switch tr.Kind() {
 				case transport.KindGRPC:
+					op = "grpc.server"
 					gtr := tr.(*grpc.Transport)
 					scope.SetContext("gRPC", map[string]interface{}{
 						"endpoint":  gtr.Endpoint(),
@@ -93,33 +217,198 @@ func Server(opts ...Option) middleware.Middleware {
 					})
 					headers := make(map[string]interface{})
 					for _, k := range gtr.RequestHeader().Keys() {
+						if !conf.headerAllowed(k) {
+							continue
+						}
 						headers[k] = gtr.RequestHeader().Get(k)
 					}
 					scope.SetContext("Headers", headers)
 				case transport.KindHTTP:
 					htr := tr.(*http2.Transport)
 					r := htr.Request()
-					scope.SetRequest(r)
+					scope.SetRequest(scrubHTTPHeaders(r, conf))
 				}
+				span = conf.startSpan(ctx, op, tr.Operation())
+				ctx = span.Context()
 			}
 
 			ctx = context.WithValue(ctx, valuesKey, hub)
-			defer recoverWithSentry(conf, hub, ctx, req)
-			return handler(ctx, req)
+			defer func() {
+				if span == nil {
+					return
+				}
+				// A panic already set span.Status from within
+				// recoverWithSentry (which runs before this defer); don't
+				// clobber it with the named err return, which a panicking
+				// handler never got to assign.
+				if span.Status == sentry.SpanStatusUndefined {
+					if err != nil {
+						span.Status = sentry.SpanStatusInternalError
+					} else {
+						span.Status = sentry.SpanStatusOK
+					}
+				}
+				span.Finish()
+			}()
+			defer recoverWithSentry(conf, hub, ctx, req, span)
+			reply, err = handler(ctx, req)
+			return reply, err
+		}
+	}
+}
+
+// startSpan starts a transaction (or, if ctx already carries a parent span,
+// a child span) named after the transport operation, with its source set to
+// sentry.SourceRoute; the transport endpoint is not recorded on the span.
+// The sampling decision is left to sentry-go's own configuration
+// unless a sampler or sample rate was supplied via options.
+func (conf options) startSpan(ctx context.Context, op, name string) *sentry.Span {
+	spanOpts := []sentry.SpanOption{
+		sentry.WithTransactionName(name),
+		sentry.WithTransactionSource(sentry.SourceRoute),
+	}
+	if sampled, ok := conf.tracesSampled(); ok {
+		spanOpts = append(spanOpts, sentry.WithSpanSampled(sampled))
+	}
+	return sentry.StartSpan(ctx, op, spanOpts...)
+}
+
+// tracesSampled resolves the sampling decision for a new transaction from
+// the configured sampler or fixed sample rate. ok is false when neither is
+// configured, in which case sentry-go falls back to its own client-level
+// TracesSampleRate/TracesSampler.
+func (conf options) tracesSampled() (sampled sentry.Sampled, ok bool) {
+	switch {
+	case conf.tracesSampler != nil:
+		return conf.tracesSampler(sentry.SamplingContext{}), true
+	case conf.tracesSampleRate > 0:
+		if rand.Float64() < conf.tracesSampleRate {
+			return sentry.SampledTrue, true
 		}
+		return sentry.SampledFalse, true
+	default:
+		return sentry.SampledUndefined, false
 	}
 }
 
-func recoverWithSentry(opts options, hub *sentry.Hub, ctx context.Context, req interface{}) {
+// Client returns a new client middleware for Sentry. It records every
+// outbound call made through transport/grpc and transport/http clients as a
+// breadcrumb on the caller's hub, and propagates the current trace so that
+// errors captured on the callee can be correlated with the caller.
+func Client(opts ...Option) middleware.Middleware {
+	conf := options{repanic: false}
+	for _, o := range opts {
+		o(&conf)
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req interface{}) (interface{}, error) {
+			hub := GetHubFromContext(ctx)
+			if hub == nil {
+				hub = sentry.GetHubFromContext(ctx)
+			}
+			if hub == nil {
+				hub = sentry.CurrentHub().Clone()
+			}
+
+			var kind transport.Kind
+			var operation, endpoint, method string
+			if tr, ok := transport.FromClientContext(ctx); ok {
+				kind = tr.Kind()
+				operation = tr.Operation()
+				endpoint = tr.Endpoint()
+				propagateTrace(hub, tr.RequestHeader())
+				switch kind {
+				case transport.KindHTTP:
+					if htr, ok := tr.(*http2.Transport); ok && htr.Request() != nil {
+						method = htr.Request().Method
+					}
+				case transport.KindGRPC:
+					// gRPC has no HTTP-verb equivalent; the operation (the
+					// full method name) is the closest thing to "method".
+					method = operation
+				}
+			}
+
+			start := time.Now()
+			reply, err := handler(ctx, req)
+
+			data := map[string]interface{}{
+				"endpoint":    endpoint,
+				"operation":   operation,
+				"method":      method,
+				"duration_ms": time.Since(start).Milliseconds(),
+			}
+			level := sentry.LevelInfo
+			if err != nil {
+				level = sentry.LevelError
+				data["error"] = err.Error()
+			}
+			breadcrumbType := "unknown"
+			if kind != "" {
+				breadcrumbType = string(kind)
+			}
+			hub.AddBreadcrumb(&sentry.Breadcrumb{
+				Type:      breadcrumbType,
+				Category:  fmt.Sprintf("%s.client", kind),
+				Message:   operation,
+				Level:     level,
+				Timestamp: start,
+				Data:      data,
+			}, nil)
+
+			return reply, err
+		}
+	}
+}
+
+// propagateTrace attaches sentry-trace/baggage headers describing the
+// active span (if any) to an outgoing request header, so the callee can
+// continue the same trace.
+func propagateTrace(hub *sentry.Hub, header transport.Header) {
+	if header == nil {
+		return
+	}
+	span := hub.Scope().Span()
+	if span == nil {
+		return
+	}
+	header.Set(sentryTraceHeader, span.ToSentryTrace())
+	if baggage := span.ToBaggage(); baggage != "" {
+		header.Set(sentryBaggageHeader, baggage)
+	}
+}
+
+// scrubHTTPHeaders returns a shallow clone of r with any denied header
+// removed, so Sentry never sees it. The original request is left untouched.
+func scrubHTTPHeaders(r *http.Request, conf options) *http.Request {
+	clone := r.Clone(r.Context())
+	clone.Header = make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		if !conf.headerAllowed(k) {
+			continue
+		}
+		clone.Header[k] = v
+	}
+	return clone
+}
+
+// transportKindAndOperation reads the transport kind and operation off ctx,
+// used to key rate-limit buckets for repeated panics.
+func transportKindAndOperation(ctx context.Context) (transport.Kind, string) {
+	tr, ok := transport.FromServerContext(ctx)
+	if !ok {
+		return "", ""
+	}
+	return tr.Kind(), tr.Operation()
+}
+
+func recoverWithSentry(opts options, hub *sentry.Hub, ctx context.Context, req interface{}, span *sentry.Span) {
 	if err := recover(); err != nil {
+		if span != nil {
+			span.Status = sentry.SpanStatusInternalError
+		}
 		if !isBrokenPipeError(err) {
-			eventID := hub.RecoverWithContext(
-				context.WithValue(ctx, sentry.RequestContextKey, req),
-				err,
-			)
-			if eventID != nil && opts.waitForDelivery {
-				hub.Flush(opts.timeout)
-			}
+			reportPanic(opts, hub, ctx, req, err)
 		}
 		if opts.repanic {
 			panic(err)
@@ -127,6 +416,79 @@ func recoverWithSentry(opts options, hub *sentry.Hub, ctx context.Context, req i
 	}
 }
 
+// setEventExtra records a key/value pair on event.Extra, so it travels with
+// the event to every CrashReporter regardless of what each reporter's
+// Report method does with its context argument.
+func setEventExtra(event *sentry.Event, key string, value interface{}) {
+	if event.Extra == nil {
+		event.Extra = make(map[string]interface{})
+	}
+	event.Extra[key] = value
+}
+
+// reportPanic builds a *sentry.Event for the recovered panic and hands it to
+// every configured CrashReporter. With no reporters configured it falls
+// back to hub, reported exactly as recoverWithSentry always has.
+func reportPanic(opts options, hub *sentry.Hub, ctx context.Context, req interface{}, recovered interface{}) {
+	if opts.sampleRate < 1 && rand.Float64() >= opts.sampleRate {
+		return
+	}
+
+	var suppressedSinceLast int
+	if opts.limiter != nil {
+		kind, operation := transportKindAndOperation(ctx)
+		key := fmt.Sprintf("%s|%s|%s", kind, operation, panicFingerprint(recovered))
+		var delivered bool
+		delivered, suppressedSinceLast = opts.limiter.allow(key)
+		if !delivered {
+			return
+		}
+	}
+
+	client := hub.Client()
+	if client == nil {
+		return
+	}
+
+	exception, ok := recovered.(error)
+	if !ok {
+		exception = fmt.Errorf("%v", recovered)
+	}
+	event := client.EventFromException(exception, sentry.LevelFatal)
+	if scope := hub.Scope(); scope != nil {
+		event = scope.ApplyToEvent(event, nil)
+	}
+	if event == nil {
+		return
+	}
+
+	if suppressedSinceLast > 0 {
+		setEventExtra(event, "suppressed_since_last", suppressedSinceLast)
+	}
+
+	if opts.bodyScrubber != nil {
+		req = opts.bodyScrubber(ctx, req)
+		setEventExtra(event, "request_body", req)
+	}
+
+	if opts.beforeSend != nil {
+		event = opts.beforeSend(event, &sentry.EventHint{Context: ctx})
+		if event == nil {
+			return
+		}
+	}
+
+	reporters := opts.reporters
+	if len(reporters) == 0 {
+		reporters = []CrashReporter{NewHubReporter(hub, opts.waitForDelivery, opts.timeout)}
+	}
+
+	ctx = context.WithValue(ctx, sentry.RequestContextKey, req)
+	for _, reporter := range reporters {
+		_ = reporter.Report(ctx, event)
+	}
+}
+
 func isBrokenPipeError(err interface{}) bool {
 	if netErr, ok := err.(*net.OpError); ok {
 		if sysErr, ok := netErr.Err.(*os.SyscallError); ok {
@@ -0,0 +1,139 @@
+package sentry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/getsentry/sentry-go"
+
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+func TestHeaderAllowedDefaultDenylist(t *testing.T) {
+	conf := options{headerDenylist: newHeaderSet(defaultHeaderDenylist)}
+
+	for _, h := range []string{"Authorization", "cookie", "X-Api-Key"} {
+		if conf.headerAllowed(h) {
+			t.Errorf("headerAllowed(%q) = true, want false", h)
+		}
+	}
+	if !conf.headerAllowed("X-Request-Id") {
+		t.Errorf("headerAllowed(%q) = false, want true", "X-Request-Id")
+	}
+}
+
+func TestHeaderAllowedAllowlistTakesPrecedence(t *testing.T) {
+	conf := options{
+		headerAllowlist: newHeaderSet([]string{"X-Request-Id"}),
+		headerDenylist:  newHeaderSet(defaultHeaderDenylist),
+	}
+
+	if !conf.headerAllowed("x-request-id") {
+		t.Errorf("expected allowlisted header to be allowed")
+	}
+	if conf.headerAllowed("X-Other") {
+		t.Errorf("expected header outside the allowlist to be denied, even though it is not on the denylist")
+	}
+}
+
+func TestWithHeaderDenylistExtendsDefault(t *testing.T) {
+	conf := options{headerDenylist: newHeaderSet(defaultHeaderDenylist)}
+	WithHeaderDenylist([]string{"X-Internal-Token"})(&conf)
+
+	if conf.headerAllowed("X-Internal-Token") {
+		t.Errorf("expected custom denylist entry to be denied")
+	}
+	if conf.headerAllowed("Authorization") {
+		t.Errorf("expected default denylist entry to still be denied")
+	}
+}
+
+// recordingReporter is a CrashReporter that keeps every event it is given.
+type recordingReporter struct{ events []*sentry.Event }
+
+func (r *recordingReporter) Report(_ context.Context, event *sentry.Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestBodyScrubberOutputReachesEvent(t *testing.T) {
+	scrubbed := map[string]string{"card_number": "[redacted]"}
+	rec := &recordingReporter{}
+	opts := options{
+		sampleRate:   1,
+		bodyScrubber: func(context.Context, interface{}) interface{} { return scrubbed },
+		reporters:    []CrashReporter{rec},
+	}
+
+	reportPanic(opts, newTestHub(t), context.Background(), "raw request", errors.New("boom"))
+
+	if len(rec.events) != 1 {
+		t.Fatalf("got %d reported events, want 1", len(rec.events))
+	}
+	got, ok := rec.events[0].Extra["request_body"]
+	if !ok {
+		t.Fatalf("expected request_body to be set on event.Extra")
+	}
+	if _, ok := got.(map[string]string); !ok {
+		t.Fatalf("request_body has type %T, want map[string]string", got)
+	}
+}
+
+func TestSetEventExtraInitializesNilMap(t *testing.T) {
+	event := &sentry.Event{}
+	setEventExtra(event, "k", "v")
+
+	if event.Extra["k"] != "v" {
+		t.Fatalf("event.Extra[%q] = %v, want %q", "k", event.Extra["k"], "v")
+	}
+}
+
+func TestServerMarksSpanOKOnSuccess(t *testing.T) {
+	hub := newTestHub(t)
+	ctx := sentry.SetHubOnContext(context.Background(), hub)
+	ctx = transport.NewServerContext(ctx, &fakeTransport{kind: "test", operation: "/ok", header: fakeHeader{}})
+
+	handler := Server()(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "reply", nil
+	})
+	if _, err := handler(ctx, "req"); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+
+	span := hub.Scope().Span()
+	if span == nil {
+		t.Fatalf("expected a span to be recorded on the hub's scope")
+	}
+	if span.Status != sentry.SpanStatusOK {
+		t.Errorf("span.Status = %v, want SpanStatusOK", span.Status)
+	}
+}
+
+// TestServerMarksSpanErroredOnPanic is a regression test for a defer
+// ordering bug: the span-finishing defer ran after recoverWithSentry's (they
+// unwind LIFO), so on panic it saw the named err return still unset and
+// reported the span as OK even though the request panicked. recoverWithSentry
+// now sets span.Status itself, and the finishing defer only fills in a
+// status that is still Undefined.
+func TestServerMarksSpanErroredOnPanic(t *testing.T) {
+	hub := newTestHub(t)
+	ctx := sentry.SetHubOnContext(context.Background(), hub)
+	ctx = transport.NewServerContext(ctx, &fakeTransport{kind: "test", operation: "/panics", header: fakeHeader{}})
+
+	handler := Server(WithRepanic(false))(func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic(errors.New("boom"))
+	})
+
+	if _, err := handler(ctx, "req"); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+
+	span := hub.Scope().Span()
+	if span == nil {
+		t.Fatalf("expected a span to be recorded on the hub's scope")
+	}
+	if span.Status != sentry.SpanStatusInternalError {
+		t.Errorf("span.Status = %v, want SpanStatusInternalError", span.Status)
+	}
+}